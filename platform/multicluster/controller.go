@@ -0,0 +1,215 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package multicluster watches for remote-cluster credentials published as
+// Kubernetes secrets in the local control plane's namespace and maintains a
+// registry of the resulting remote clientsets, following the same
+// secret-based discovery pattern used by Istio's Admiral project.
+package multicluster
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// MultiClusterSecretLabel marks a Secret as carrying a remote cluster's
+// kubeconfig. Its value is always "true".
+const MultiClusterSecretLabel = "istio/multiCluster"
+
+// Registry tracks a kubernetes.Clientset per remote cluster, keyed by the
+// name of the Secret that published its credentials.
+type Registry struct {
+	mu         sync.RWMutex
+	clientsets map[string]kubernetes.Interface
+}
+
+// NewRegistry returns an empty cluster registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		clientsets: make(map[string]kubernetes.Interface),
+	}
+}
+
+// Get returns the clientset registered for cluster name, if any.
+func (r *Registry) Get(name string) (kubernetes.Interface, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	cs, ok := r.clientsets[name]
+	return cs, ok
+}
+
+// Names returns the cluster names currently registered.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.clientsets))
+	for name := range r.clientsets {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (r *Registry) set(name string, cs kubernetes.Interface) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clientsets[name] = cs
+}
+
+func (r *Registry) delete(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.clientsets, name)
+}
+
+// Controller watches Secrets labeled with MultiClusterSecretLabel in a
+// namespace and keeps a Registry of remote clientsets in sync with them.
+type Controller struct {
+	Registry *Registry
+
+	client    kubernetes.Interface
+	namespace string
+	store     cache.Store
+	informer  cache.Controller
+}
+
+// NewController creates a Controller that watches namespace on client for
+// multi-cluster credential secrets.
+func NewController(client kubernetes.Interface, namespace string) *Controller {
+	c := &Controller{
+		Registry:  NewRegistry(),
+		client:    client,
+		namespace: namespace,
+	}
+
+	c.store, c.informer = cache.NewInformer(
+		&cache.ListWatch{
+			ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+				options.LabelSelector = MultiClusterSecretLabel + "=true"
+				return client.CoreV1().Secrets(namespace).List(options)
+			},
+			WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+				options.LabelSelector = MultiClusterSecretLabel + "=true"
+				return client.CoreV1().Secrets(namespace).Watch(options)
+			},
+		},
+		&v1.Secret{},
+		30*time.Second,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc:    c.addSecret,
+			UpdateFunc: func(_, newObj interface{}) { c.addSecret(newObj) },
+			DeleteFunc: c.deleteSecret,
+		},
+	)
+
+	return c
+}
+
+// Run starts the informer and blocks until stopCh is closed.
+func (c *Controller) Run(stopCh <-chan struct{}) {
+	glog.Infof("multicluster: watching Secrets in %q for remote cluster credentials", c.namespace)
+	c.informer.Run(stopCh)
+}
+
+// HasSynced reports whether the informer's initial list has completed.
+func (c *Controller) HasSynced() bool {
+	return c.informer.HasSynced()
+}
+
+func (c *Controller) addSecret(obj interface{}) {
+	secret, ok := obj.(*v1.Secret)
+	if !ok {
+		glog.Warningf("multicluster: unexpected object type %T in secret handler", obj)
+		return
+	}
+
+	clusterName := secret.Name
+	kubeconfig, ok := secretKubeconfig(secret)
+	if !ok {
+		glog.Errorf("multicluster: secret %q has no kubeconfig data", secret.Name)
+		return
+	}
+
+	restConfig, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		glog.Errorf("multicluster: failed to parse kubeconfig from secret %q: %v", secret.Name, err)
+		return
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		glog.Errorf("multicluster: failed to build clientset for cluster %q: %v", clusterName, err)
+		return
+	}
+
+	c.Registry.set(clusterName, clientset)
+	glog.Infof("multicluster: registered remote cluster %q", clusterName)
+}
+
+func (c *Controller) deleteSecret(obj interface{}) {
+	secret, ok := obj.(*v1.Secret)
+	if !ok {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			secret, ok = tombstone.Obj.(*v1.Secret)
+			if !ok {
+				glog.Warningf("multicluster: unexpected tombstone object type %T", tombstone.Obj)
+				return
+			}
+		} else {
+			glog.Warningf("multicluster: unexpected object type %T in delete handler", obj)
+			return
+		}
+	}
+
+	c.Registry.delete(secret.Name)
+	glog.Infof("multicluster: unregistered remote cluster %q", secret.Name)
+}
+
+// secretKubeconfig returns a non-empty kubeconfig payload from a multi-cluster
+// secret's data, whatever key it is stored under. If the secret holds several
+// non-empty entries, which one is returned is not defined.
+func secretKubeconfig(secret *v1.Secret) ([]byte, bool) {
+	for _, data := range secret.Data {
+		if len(data) > 0 {
+			return data, true
+		}
+	}
+	return nil, false
+}
+
+// BuildSecret renders the Secret object that publishes a remote cluster's
+// kubeconfig for discovery by Controller, keyed under the cluster's own name.
+func BuildSecret(clusterName, namespace string, kubeconfig []byte) *v1.Secret {
+	return &v1.Secret{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				MultiClusterSecretLabel: "true",
+			},
+		},
+		Data: map[string][]byte{
+			clusterName: kubeconfig,
+		},
+	}
+}
+
@@ -0,0 +1,78 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"time"
+
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// CRDName is the name of the IstioOperator CRD, as applied by
+// operator-crd.yaml.tmpl.
+const CRDName = "istiooperators.install.istio.io"
+
+// crdGroupVersionResource identifies the (cluster-scoped)
+// CustomResourceDefinition resource itself, as opposed to GroupVersionResource
+// which identifies instances of the CRD it defines.
+var crdGroupVersionResource = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1beta1",
+	Resource: "customresourcedefinitions",
+}
+
+// WaitCRDEstablished polls the named CustomResourceDefinition until the API
+// server reports its "Established" condition as True, or returns an error
+// once timeout elapses. The API server will not accept instances of a CRD
+// (such as the IstioOperator CR) until this happens.
+func WaitCRDEstablished(dynamicClient dynamic.Interface, name string, timeout time.Duration) error {
+	crds := dynamicClient.Resource(crdGroupVersionResource)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		obj, err := crds.Get(name, meta_v1.GetOptions{})
+		if err == nil && crdEstablished(obj) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("CRD %q not Established after %s: %v", name, timeout, err)
+			}
+			return fmt.Errorf("CRD %q not Established after %s", name, timeout)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func crdEstablished(obj *unstructured.Unstructured) bool {
+	conditions, found, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if err != nil || !found {
+		return false
+	}
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if condition["type"] == "Established" && condition["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
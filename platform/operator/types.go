@@ -0,0 +1,90 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package operator models the IstioOperator custom resource that drives an
+// operator-managed control plane install, as an alternative to applying the
+// per-component templates (pilot.yaml.tmpl, mixer.yaml.tmpl, ...) directly.
+package operator
+
+import (
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// GroupVersion is the API group/version the IstioOperator CRD is registered
+// under.
+var GroupVersion = schema.GroupVersion{Group: "install.istio.io", Version: "v1alpha2"}
+
+// Resource is the plural resource name of the IstioOperator CRD.
+const Resource = "istiooperators"
+
+// GroupVersionResource identifies the IstioOperator CRD for the dynamic
+// client.
+var GroupVersionResource = GroupVersion.WithResource(Resource)
+
+// Components toggles which control plane components the operator installs,
+// mirroring the infra switches (Mixer, Ingress, Egress, Auth, Zipkin) used by
+// the template-based install path.
+type Components struct {
+	Mixer   bool
+	Ingress bool
+	Egress  bool
+	Auth    bool
+	Zipkin  bool
+}
+
+// ReadyStatus is the value of .status.status once the operator has finished
+// reconciling a CR.
+const ReadyStatus = "Ready"
+
+// BuildCR renders the IstioOperator CR that the operator reconciles into a
+// running control plane, toggling components per c.
+func BuildCR(namespace, name string, c Components) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": GroupVersion.String(),
+			"kind":       "IstioOperator",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": namespace,
+			},
+			"spec": map[string]interface{}{
+				"components": map[string]interface{}{
+					"pilot":   map[string]interface{}{"enabled": true},
+					"mixer":   map[string]interface{}{"enabled": c.Mixer},
+					"ingress": map[string]interface{}{"enabled": c.Ingress},
+					"egress":  map[string]interface{}{"enabled": c.Egress},
+					"citadel": map[string]interface{}{"enabled": c.Auth},
+					"zipkin":  map[string]interface{}{"enabled": c.Zipkin},
+				},
+			},
+		},
+	}
+}
+
+// Status reads .status.status off a fetched IstioOperator object.
+func Status(obj *unstructured.Unstructured) string {
+	status, _, _ := unstructured.NestedString(obj.Object, "status", "status")
+	return status
+}
+
+// TypeMeta returns the TypeMeta matching the IstioOperator CRD, for callers
+// that build typed requests against it.
+func TypeMeta() meta_v1.TypeMeta {
+	return meta_v1.TypeMeta{
+		APIVersion: GroupVersion.String(),
+		Kind:       "IstioOperator",
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"time"
+
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+)
+
+// WaitReady polls the named IstioOperator CR until the operator marks it
+// Ready, or returns an error once timeout elapses. A Get error (such as the
+// ordinary propagation delay right after the CR is first applied) is
+// retried like any other not-yet-Ready state, matching WaitCRDEstablished.
+func WaitReady(dynamicClient dynamic.Interface, namespace, name string, timeout time.Duration) error {
+	cr := dynamicClient.Resource(GroupVersionResource).Namespace(namespace)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		obj, err := cr.Get(name, meta_v1.GetOptions{})
+		if err == nil && Status(obj) == ReadyStatus {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("IstioOperator %s/%s not Ready after %s: %v", namespace, name, timeout, err)
+			}
+			return fmt.Errorf("IstioOperator %s/%s not Ready after %s (status=%q)",
+				namespace, name, timeout, Status(obj))
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
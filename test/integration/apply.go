@@ -0,0 +1,193 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// fieldManager identifies this test harness to the API server's server-side
+// apply conflict tracking.
+const fieldManager = "istio-pilot-test"
+
+// kubeApplier applies and deletes rendered YAML against a single cluster
+// using server-side apply over the dynamic client, replacing a per-call
+// "kubectl apply"/"kubectl delete" shell-out.
+type kubeApplier struct {
+	dynamicClient dynamic.Interface
+	restMapper    *restmapper.DeferredDiscoveryRESTMapper
+}
+
+// newKubeApplier builds a kubeApplier for the cluster reachable via
+// kubeconfigPath.
+func newKubeApplier(kubeconfigPath string) (*kubeApplier, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kubeApplier{
+		dynamicClient: dynamicClient,
+		restMapper:    restmapper.NewDeferredDiscoveryRESTMapper(memoryCachedDiscovery(discoveryClient)),
+	}, nil
+}
+
+// decodeObjects splits a multi-document YAML stream into unstructured
+// objects.
+func decodeObjects(yaml string) ([]*unstructured.Unstructured, error) {
+	var objs []*unstructured.Unstructured
+	decoder := k8syaml.NewYAMLOrJSONDecoder(bufio.NewReader(bytes.NewReader([]byte(yaml))), 4096)
+	for {
+		raw := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		if err := decoder.Decode(raw); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if len(raw.Object) == 0 {
+			continue
+		}
+		objs = append(objs, raw)
+	}
+	return objs, nil
+}
+
+func (a *kubeApplier) resourceFor(obj *unstructured.Unstructured, namespace string) (dynamic.ResourceInterface, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := a.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		// reload discovery once, in case the kind was registered after the
+		// mapper last loaded it
+		a.restMapper.Reset()
+		mapping, err = a.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %v", gvk, err)
+	}
+
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		return a.dynamicClient.Resource(mapping.Resource), nil
+	}
+	ns := obj.GetNamespace()
+	if ns == "" {
+		ns = namespace
+	}
+	return a.dynamicClient.Resource(mapping.Resource).Namespace(ns), nil
+}
+
+// Apply server-side applies every object decoded from yaml into namespace,
+// forcing through field-manager conflicts since the test harness is the
+// sole writer of these resources.
+func (a *kubeApplier) Apply(yaml, namespace string) error {
+	objs, err := decodeObjects(yaml)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		if err := a.ApplyObject(obj, namespace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyObject server-side applies a single already-built object into
+// namespace, for callers that construct the object in code (e.g. the
+// operator CR) rather than rendering it from a YAML template.
+func (a *kubeApplier) ApplyObject(obj *unstructured.Unstructured, namespace string) error {
+	res, err := a.resourceFor(obj, namespace)
+	if err != nil {
+		return err
+	}
+
+	data, err := runtime.Encode(unstructured.UnstructuredJSONScheme, obj)
+	if err != nil {
+		return err
+	}
+
+	force := true
+	_, err = res.Patch(obj.GetName(), types.ApplyPatchType, data, meta_v1.PatchOptions{
+		FieldManager: fieldManager,
+		Force:        &force,
+	})
+	return err
+}
+
+// Delete removes every object decoded from yaml from namespace, using
+// propagationPolicy for cascading deletes.
+func (a *kubeApplier) Delete(yaml, namespace string, propagationPolicy meta_v1.DeletionPropagation) error {
+	objs, err := decodeObjects(yaml)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		res, err := a.resourceFor(obj, namespace)
+		if err != nil {
+			return err
+		}
+
+		err = res.Delete(obj.GetName(), &meta_v1.DeleteOptions{
+			PropagationPolicy: &propagationPolicy,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// memoryCachedDiscovery adapts a plain discovery client to
+// discovery.CachedDiscoveryInterface so it can back a
+// DeferredDiscoveryRESTMapper. It always reports itself as up to date, so the
+// mapper does not reset itself on a miss; resourceFor resets it and retries
+// once instead, which picks up a kind registered after the mapper was built
+// (like the operator's IstioOperator CRD).
+func memoryCachedDiscovery(d discovery.DiscoveryInterface) discovery.CachedDiscoveryInterface {
+	return memcachedDiscovery{d}
+}
+
+type memcachedDiscovery struct {
+	discovery.DiscoveryInterface
+}
+
+func (m memcachedDiscovery) Fresh() bool { return true }
+func (m memcachedDiscovery) Invalidate() {}
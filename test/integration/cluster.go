@@ -0,0 +1,118 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"istio.io/pilot/platform/multicluster"
+)
+
+// remoteKubeconfigs is a comma-separated "name=kubeconfig" list, one entry
+// per remote cluster in a multi-cluster test topology, e.g.
+// "-remote-kubeconfigs=west=/path/to/west.yaml,east=/path/to/east.yaml".
+var remoteKubeconfigs = flag.String("remote-kubeconfigs", "",
+	"comma-separated name=kubeconfig pairs for remote clusters in a multi-cluster test topology")
+
+// cluster holds everything a single Kubernetes cluster needs in order to
+// participate in the integration test topology: its own client, its own
+// namespace pair, and the set of apps deployed into it.
+type cluster struct {
+	Name       string
+	Kubeconfig string
+
+	client  kubernetes.Interface
+	applier *kubeApplier
+
+	Namespace      string
+	IstioNamespace string
+
+	// map from app to pods, scoped to this cluster
+	apps map[string][]string
+
+	namespaceCreated      bool
+	istioNamespaceCreated bool
+}
+
+// newCluster builds a cluster from a kubeconfig path, eagerly creating its
+// clientset so setup() failures surface before any deploy step runs.
+func newCluster(name, kubeconfigPath string) (*cluster, error) {
+	restConfig, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("cluster %q: %v", name, err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cluster %q: %v", name, err)
+	}
+
+	applier, err := newKubeApplier(kubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("cluster %q: %v", name, err)
+	}
+
+	return &cluster{
+		Name:       name,
+		Kubeconfig: kubeconfigPath,
+		client:     clientset,
+		applier:    applier,
+		apps:       make(map[string][]string),
+	}, nil
+}
+
+// secret renders the Secret that publishes this cluster's kubeconfig for
+// discovery by the primary cluster's multicluster.Controller.
+func (c *cluster) secret(namespace string) (*v1.Secret, error) {
+	data, err := ioutil.ReadFile(c.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	return multicluster.BuildSecret(c.Name, namespace, data), nil
+}
+
+func (c *cluster) String() string {
+	return c.Name
+}
+
+// loadRemoteClusters parses the -remote-kubeconfigs flag into the cluster
+// set that populates infra.clusters, the entry point that actually wires a
+// multi-cluster topology into a test run.
+func loadRemoteClusters() ([]*cluster, error) {
+	if *remoteKubeconfigs == "" {
+		return nil, nil
+	}
+
+	var clusters []*cluster
+	for _, pair := range strings.Split(*remoteKubeconfigs, ",") {
+		nameAndPath := strings.SplitN(pair, "=", 2)
+		if len(nameAndPath) != 2 {
+			return nil, fmt.Errorf("invalid -remote-kubeconfigs entry %q, want name=kubeconfig", pair)
+		}
+		c, err := newCluster(nameAndPath[0], nameAndPath[1])
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, c)
+	}
+	return clusters, nil
+}
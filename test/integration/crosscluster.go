@@ -0,0 +1,89 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// registrySyncTimeout bounds how long run() waits for the multi-cluster
+// secret-watch Controller to finish its initial list before giving up on
+// discovery having happened at all.
+const registrySyncTimeout = 30 * time.Second
+
+// crosscluster exercises Pilot's remote-endpoint discovery: an app deployed
+// in the primary cluster calls a service deployed into a remote cluster via
+// the remote-cluster gateway set up by setupRemoteClusters, and run() checks
+// that the remote was actually discovered off its kubeconfig Secret rather
+// than just assuming the static cluster list is reachable.
+type crosscluster struct {
+	*infra
+}
+
+func (t *crosscluster) String() string {
+	return "crosscluster"
+}
+
+func (t *crosscluster) setup() error {
+	return nil
+}
+
+func (t *crosscluster) teardown() {
+}
+
+func (t *crosscluster) run() error {
+	if len(t.clusters) == 0 {
+		return nil
+	}
+
+	if t.multiClusterCtrl == nil {
+		return errors.New("crosscluster: multiClusterCtrl is not set, discovery was never started")
+	}
+
+	deadline := time.Now().Add(registrySyncTimeout)
+	for !t.multiClusterCtrl.HasSynced() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("crosscluster: Registry did not sync within %s", registrySyncTimeout)
+		}
+		time.Sleep(time.Second)
+	}
+
+	for _, remote := range t.clusters {
+		if _, ok := t.multiClusterCtrl.Registry.Get(remote.Name); !ok {
+			return fmt.Errorf("crosscluster: remote cluster %q was never discovered via its kubeconfig secret (registered: %v)",
+				remote.Name, t.multiClusterCtrl.Registry.Names())
+		}
+	}
+
+	f := func() status {
+		for _, remote := range t.clusters {
+			url := fmt.Sprintf("http://%s-remote.%s", remote.Name, t.IstioNamespace)
+			response := t.clientRequest("a", url, 1, "")
+			if len(response.code) == 0 || response.code[0] != httpOk {
+				return errors.New(response.body)
+			}
+			if len(response.version) == 0 {
+				return fmt.Errorf("no response version recorded for cluster %q", remote.Name)
+			}
+		}
+		return nil
+	}
+
+	return parallel(map[string]func() status{
+		"call service across clusters": f,
+	})
+}
@@ -27,13 +27,17 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/golang/glog"
 	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
 
 	proxyconfig "istio.io/api/proxy/v1/config"
 	"istio.io/pilot/adapter/config/crd"
 	"istio.io/pilot/model"
 	"istio.io/pilot/platform"
 	"istio.io/pilot/platform/kube/inject"
+	"istio.io/pilot/platform/multicluster"
 	"istio.io/pilot/test/util"
 )
 
@@ -41,6 +45,19 @@ const (
 	ingressSecretName = "istio-ingress-certs"
 )
 
+// InstallMode selects how setup() brings up the Istio control plane.
+type InstallMode string
+
+const (
+	// Templates applies the per-component templates (pilot.yaml.tmpl,
+	// mixer.yaml.tmpl, ca.yaml.tmpl, ...) directly. This is the default.
+	Templates InstallMode = "Templates"
+	// Operator applies a single IstioOperator CR and waits for the
+	// operator to reconcile it, instead of applying per-component
+	// templates.
+	Operator InstallMode = "Operator"
+)
+
 type infra struct { // nolint: aligncheck
 	Name string
 
@@ -53,6 +70,10 @@ type infra struct { // nolint: aligncheck
 	Registry       string
 	Verbosity      int
 
+	// InstallMode selects between the per-component templates and a
+	// single operator-managed CR; defaults to Templates.
+	InstallMode InstallMode
+
 	// map from app to pods
 	apps map[string][]string
 
@@ -65,8 +86,10 @@ type infra struct { // nolint: aligncheck
 	Zipkin    bool
 	DebugPort int
 
-	// switch to test mongodb filter
+	// switches for the pluggable protocol test drivers; populated from a
+	// single --protocols flag via setProtocolFlags
 	Mongo bool
+	Redis bool
 
 	// check proxy logs
 	checkLogs bool
@@ -84,9 +107,70 @@ type infra struct { // nolint: aligncheck
 	AdmissionServiceName string
 
 	config model.IstioConfigStore
+
+	// remote clusters in a multi-cluster test bed; the primary cluster
+	// (reached via kubeconfig/client) is not included in this slice
+	clusters         []*cluster
+	multiClusterCtrl *multicluster.Controller
+	multiClusterStop chan struct{}
+
+	// primaryApplier server-side applies rendered YAML against the
+	// primary cluster; see kubeApply/kubeDelete.
+	primaryApplier *kubeApplier
+
+	// DeletePropagationPolicy controls how kubeDelete cascades deletes of
+	// the objects it removes; defaults to Foreground so teardown doesn't
+	// race ahead of dependent objects actually being gone.
+	DeletePropagationPolicy meta_v1.DeletionPropagation
+
+	// Ephemeral, when set, has setup() provision a throwaway Kind cluster
+	// pinned to KubeVersion before any deploy step runs, instead of relying
+	// on an externally provisioned cluster reachable via kubeconfig.
+	Ephemeral   bool
+	KubeVersion string
+
+	// IstioVersion, when set, selects the control-plane image tag setup()
+	// deploys, overriding Tag. It mirrors MatrixEntry.IstioVersion so a
+	// single-run infra can be pinned to one matrix cell without the caller
+	// threading Tag through by hand.
+	IstioVersion string
+
+	kindCluster *kindCluster
 }
 
 func (infra *infra) setup() error {
+	if infra.IstioVersion != "" {
+		infra.Tag = infra.IstioVersion
+	}
+
+	if infra.Ephemeral {
+		kc, err := newKindCluster(infra.Name, infra.KubeVersion)
+		if err != nil {
+			return err
+		}
+		infra.kindCluster = kc
+		kubeconfig = kc.Kubeconfig
+
+		restConfig, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+		if err != nil {
+			return err
+		}
+		if client, err = kubernetes.NewForConfig(restConfig); err != nil {
+			return err
+		}
+	}
+
+	if infra.clusters == nil {
+		clusters, err := loadRemoteClusters()
+		if err != nil {
+			return err
+		}
+		infra.clusters = clusters
+	}
+
+	infra.resolveInstallMode()
+	setProtocolFlags(infra, *protocols)
+
 	crdclient, crderr := crd.NewClient(kubeconfig, model.IstioConfigTypes, "")
 	if crderr != nil {
 		return crderr
@@ -197,30 +281,49 @@ func (infra *infra) setup() error {
 		return err
 	}
 
-	if err := deploy("pilot.yaml.tmpl", infra.IstioNamespace); err != nil {
-		return err
-	}
-	if err := deploy("mixer.yaml.tmpl", infra.IstioNamespace); err != nil {
-		return err
-	}
-	if platform.ServiceRegistry(infra.Registry) == platform.EurekaRegistry {
-		if err := deploy("eureka.yaml.tmpl", infra.IstioNamespace); err != nil {
+	if infra.InstallMode == Operator {
+		if err := infra.deployControlPlaneViaOperator(); err != nil {
+			return err
+		}
+	} else {
+		if err := deploy("pilot.yaml.tmpl", infra.IstioNamespace); err != nil {
+			return err
+		}
+		if err := deploy("mixer.yaml.tmpl", infra.IstioNamespace); err != nil {
 			return err
 		}
+		if infra.Auth != proxyconfig.MeshConfig_NONE {
+			if err := deploy("ca.yaml.tmpl", infra.IstioNamespace); err != nil {
+				return err
+			}
+		}
+		if infra.Ingress {
+			if err := deploy("ingress-proxy.yaml.tmpl", infra.IstioNamespace); err != nil {
+				return err
+			}
+		}
+		if infra.Egress {
+			if err := deploy("egress-proxy.yaml.tmpl", infra.IstioNamespace); err != nil {
+				return err
+			}
+		}
+		if infra.Zipkin {
+			if err := deploy("zipkin.yaml", infra.IstioNamespace); err != nil {
+				return err
+			}
+		}
 	}
 
-	if infra.Auth != proxyconfig.MeshConfig_NONE {
-		if err := deploy("ca.yaml.tmpl", infra.IstioNamespace); err != nil {
+	if platform.ServiceRegistry(infra.Registry) == platform.EurekaRegistry {
+		if err := deploy("eureka.yaml.tmpl", infra.IstioNamespace); err != nil {
 			return err
 		}
 	}
+
 	if err := deploy("headless.yaml.tmpl", infra.Namespace); err != nil {
 		return err
 	}
 	if infra.Ingress {
-		if err := deploy("ingress-proxy.yaml.tmpl", infra.IstioNamespace); err != nil {
-			return err
-		}
 		// Create ingress key/cert in secret
 		key, err := ioutil.ReadFile("docker/certs/cert.key")
 		if err != nil {
@@ -241,57 +344,133 @@ func (infra *infra) setup() error {
 			return err
 		}
 	}
-	if infra.Egress {
-		if err := deploy("egress-proxy.yaml.tmpl", infra.IstioNamespace); err != nil {
+
+	if infra.Mongo {
+		if err := deploy("mongo.yaml", infra.IstioNamespace); err != nil {
 			return err
 		}
 	}
 
-	if infra.Zipkin {
-		if err := deploy("zipkin.yaml", infra.IstioNamespace); err != nil {
+	if infra.Redis {
+		if err := deploy("redis.yaml", infra.IstioNamespace); err != nil {
 			return err
 		}
 	}
 
-	if infra.Mongo {
-		if err := deploy("mongo.yaml", infra.IstioNamespace); err != nil {
+	if err := infra.setupRemoteClusters(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// setupRemoteClusters brings up the namespace pair in every remote cluster
+// and publishes its kubeconfig as a Secret on the primary cluster, following
+// the same secret-based discovery pattern as Admiral. Pilot's own discovery
+// of those clientsets is driven by the multicluster.Controller started here.
+func (infra *infra) setupRemoteClusters() error {
+	if len(infra.clusters) == 0 {
+		return nil
+	}
+
+	for _, remote := range infra.clusters {
+		if remote.Namespace == "" {
+			ns, err := util.CreateNamespace(remote.client)
+			if err != nil {
+				return err
+			}
+			remote.Namespace = ns
+			remote.namespaceCreated = true
+		}
+		if remote.IstioNamespace == "" {
+			ns, err := util.CreateNamespace(remote.client)
+			if err != nil {
+				return err
+			}
+			remote.IstioNamespace = ns
+			remote.istioNamespaceCreated = true
+		}
+
+		secret, err := remote.secret(infra.IstioNamespace)
+		if err != nil {
+			return err
+		}
+		if _, err := client.CoreV1().Secrets(infra.IstioNamespace).Create(secret); err != nil {
+			return err
+		}
+
+		// deploy the remote-cluster gateway that crosscluster.run() calls
+		// into, fronting the remote cluster's services from the primary
+		yaml, err := fill("remote-gateway.yaml.tmpl", map[string]string{
+			"Name":           remote.Name,
+			"Hub":            infra.Hub,
+			"Tag":            infra.Tag,
+			"IstioNamespace": infra.IstioNamespace,
+		})
+		if err != nil {
+			return err
+		}
+		if err := infra.kubeApply(yaml, infra.IstioNamespace); err != nil {
 			return err
 		}
 	}
 
+	infra.multiClusterCtrl = multicluster.NewController(client, infra.IstioNamespace)
+	infra.multiClusterStop = make(chan struct{})
+	go infra.multiClusterCtrl.Run(infra.multiClusterStop)
+
 	return nil
 }
 
 func (infra *infra) deployApps() error {
 	// deploy a healthy mix of apps, with and without proxy
-	if err := infra.deployApp("t", "t", 8080, 80, 9090, 90, 7070, 70, "unversioned", false); err != nil {
+	if err := infra.deployApp("t", "t", 8080, 80, 9090, 90, 7070, 70, "unversioned", false, ""); err != nil {
 		return err
 	}
-	if err := infra.deployApp("a", "a", 8080, 80, 9090, 90, 7070, 70, "v1", true); err != nil {
+	if err := infra.deployApp("a", "a", 8080, 80, 9090, 90, 7070, 70, "v1", true, ""); err != nil {
 		return err
 	}
-	if err := infra.deployApp("b", "b", 80, 8080, 90, 9090, 70, 7070, "unversioned", true); err != nil {
+	if err := infra.deployApp("b", "b", 80, 8080, 90, 9090, 70, 7070, "unversioned", true, ""); err != nil {
 		return err
 	}
-	if err := infra.deployApp("c-v1", "c", 80, 8080, 90, 9090, 70, 7070, "v1", true); err != nil {
+	if err := infra.deployApp("c-v1", "c", 80, 8080, 90, 9090, 70, 7070, "v1", true, ""); err != nil {
 		return err
 	}
-	if err := infra.deployApp("c-v2", "c", 80, 8080, 90, 9090, 70, 7070, "v2", true); err != nil {
+	if err := infra.deployApp("c-v2", "c", 80, 8080, 90, 9090, 70, 7070, "v2", true, ""); err != nil {
 		return err
 	}
+
+	// in a multi-cluster test bed, also spread a copy of "b" onto each
+	// remote cluster so that cross-cluster discovery tests have something
+	// to call into on the far side
+	for _, remote := range infra.clusters {
+		if err := infra.deployApp("b", "b", 80, 8080, 90, 9090, 70, 7070, "unversioned", true, remote.Name); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// deployApp renders and applies the app template. When onCluster is empty
+// the app is deployed to the primary cluster; otherwise it is deployed to
+// the named entry in infra.clusters.
 func (infra *infra) deployApp(deployment, svcName string,
 	port1, port2, port3, port4, port5, port6 int,
 	version string,
-	injectProxy bool) error {
+	injectProxy bool,
+	onCluster string) error {
 	// Eureka does not support management ports
 	healthPort := "true"
 	if platform.ServiceRegistry(infra.Registry) == platform.EurekaRegistry {
 		healthPort = "false"
 	}
 
+	target, err := infra.targetCluster(onCluster)
+	if err != nil {
+		return err
+	}
+
 	w, err := fill("app.yaml.tmpl", map[string]string{
 		"Hub":            infra.Hub,
 		"Tag":            infra.Tag,
@@ -304,7 +483,7 @@ func (infra *infra) deployApp(deployment, svcName string,
 		"port5":          strconv.Itoa(port5),
 		"port6":          strconv.Itoa(port6),
 		"version":        version,
-		"istioNamespace": infra.IstioNamespace,
+		"istioNamespace": target.istioNamespace(infra),
 		"injectProxy":    strconv.FormatBool(injectProxy),
 		"healthPort":     healthPort,
 	})
@@ -324,7 +503,39 @@ func (infra *infra) deployApp(deployment, svcName string,
 		}
 	}
 
-	return infra.kubeApply(writer.String(), infra.Namespace)
+	return target.apply(infra, writer.String())
+}
+
+// deployTarget abstracts over "the primary cluster" and "a remote cluster"
+// so deployApp can apply to either without branching at every call site.
+type deployTarget struct {
+	remote *cluster
+}
+
+func (infra *infra) targetCluster(onCluster string) (deployTarget, error) {
+	if onCluster == "" {
+		return deployTarget{}, nil
+	}
+	for _, remote := range infra.clusters {
+		if remote.Name == onCluster {
+			return deployTarget{remote: remote}, nil
+		}
+	}
+	return deployTarget{}, fmt.Errorf("no such remote cluster %q", onCluster)
+}
+
+func (t deployTarget) istioNamespace(infra *infra) string {
+	if t.remote == nil {
+		return infra.IstioNamespace
+	}
+	return t.remote.IstioNamespace
+}
+
+func (t deployTarget) apply(infra *infra, yaml string) error {
+	if t.remote == nil {
+		return infra.kubeApply(yaml, infra.Namespace)
+	}
+	return applyWithRetry(func() error { return t.remote.applier.Apply(yaml, t.remote.Namespace) })
 }
 
 func (infra *infra) teardown() {
@@ -336,6 +547,20 @@ func (infra *infra) teardown() {
 		glog.Infof("RBAC config could could not be deleted: %v", err)
 	}
 
+	if infra.multiClusterStop != nil {
+		close(infra.multiClusterStop)
+	}
+	for _, remote := range infra.clusters {
+		if remote.namespaceCreated {
+			util.DeleteNamespace(remote.client, remote.Namespace)
+			remote.Namespace = ""
+		}
+		if remote.istioNamespaceCreated {
+			util.DeleteNamespace(remote.client, remote.IstioNamespace)
+			remote.IstioNamespace = ""
+		}
+	}
+
 	if infra.namespaceCreated {
 		util.DeleteNamespace(client, infra.Namespace)
 		infra.Namespace = ""
@@ -344,16 +569,62 @@ func (infra *infra) teardown() {
 		util.DeleteNamespace(client, infra.IstioNamespace)
 		infra.IstioNamespace = ""
 	}
+
+	if infra.kindCluster != nil {
+		if err := infra.kindCluster.Delete(); err != nil {
+			glog.Infof("Kind cluster %q could not be deleted: %v", infra.kindCluster.Name, err)
+		}
+		infra.kindCluster = nil
+	}
+}
+
+// applier lazily builds and caches the dynamic-client applier for the
+// primary cluster's kubeconfig.
+func (infra *infra) applier() (*kubeApplier, error) {
+	if infra.primaryApplier == nil {
+		a, err := newKubeApplier(kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		infra.primaryApplier = a
+	}
+	return infra.primaryApplier, nil
 }
 
 func (infra *infra) kubeApply(yaml, namespace string) error {
-	return util.RunInput(fmt.Sprintf("kubectl apply --kubeconfig %s -n %s -f -",
-		kubeconfig, namespace), yaml)
+	a, err := infra.applier()
+	if err != nil {
+		return err
+	}
+	return applyWithRetry(func() error { return a.Apply(yaml, namespace) })
 }
 
 func (infra *infra) kubeDelete(yaml, namespace string) error {
-	return util.RunInput(fmt.Sprintf("kubectl delete --kubeconfig %s -n %s -f -",
-		kubeconfig, namespace), yaml)
+	a, err := infra.applier()
+	if err != nil {
+		return err
+	}
+	policy := infra.DeletePropagationPolicy
+	if policy == "" {
+		policy = meta_v1.DeletePropagationForeground
+	}
+	return a.Delete(yaml, namespace, policy)
+}
+
+// applyWithRetry retries apply up to five times on conflict and
+// already-exists errors; conflicts are
+// expected when the operator and the test harness race to reconcile the
+// same object via server-side apply.
+func applyWithRetry(apply func() error) error {
+	var err error
+	for attempt := 0; attempt < 5; attempt++ {
+		err = apply()
+		if err == nil || !(errors.IsConflict(err) || errors.IsAlreadyExists(err)) {
+			return err
+		}
+		time.Sleep(time.Duration(attempt+1) * 200 * time.Millisecond)
+	}
+	return err
 }
 
 type response struct {
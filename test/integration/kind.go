@@ -0,0 +1,153 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+
+	"istio.io/pilot/test/util"
+)
+
+// kindCluster is a throwaway Kubernetes cluster provisioned by "kind" for a
+// single Ephemeral test run, pinned to a specific node image.
+type kindCluster struct {
+	Name       string
+	Kubeconfig string
+
+	configFile string
+}
+
+const kindConfigTemplate = `kind: Cluster
+apiVersion: kind.sigs.k8s.io/v1alpha3
+nodes:
+- role: control-plane
+  image: kindest/node:%s
+`
+
+// newKindCluster renders a kind config pinned to kubeVersion, creates the
+// cluster, and returns a handle whose Kubeconfig field is ready to use.
+func newKindCluster(name, kubeVersion string) (*kindCluster, error) {
+	configFile, err := ioutil.TempFile("", fmt.Sprintf("kind-%s-*.yaml", name))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := configFile.WriteString(fmt.Sprintf(kindConfigTemplate, kubeVersion)); err != nil {
+		return nil, err
+	}
+	if err := configFile.Close(); err != nil {
+		return nil, err
+	}
+
+	kubeconfigFile, err := ioutil.TempFile("", fmt.Sprintf("kind-%s-kubeconfig-*", name))
+	if err != nil {
+		return nil, err
+	}
+	if err := kubeconfigFile.Close(); err != nil {
+		return nil, err
+	}
+
+	glog.Infof("kind: creating ephemeral cluster %q (kubernetes %s)", name, kubeVersion)
+	cmd := fmt.Sprintf("kind create cluster --name %s --config %s --kubeconfig %s",
+		name, configFile.Name(), kubeconfigFile.Name())
+	if _, err := util.Shell(cmd); err != nil {
+		return nil, fmt.Errorf("kind create cluster %q: %v", name, err)
+	}
+
+	return &kindCluster{
+		Name:       name,
+		Kubeconfig: kubeconfigFile.Name(),
+		configFile: configFile.Name(),
+	}, nil
+}
+
+// Delete tears down the ephemeral cluster and its temporary config files.
+func (k *kindCluster) Delete() error {
+	_, err := util.Shell(fmt.Sprintf("kind delete cluster --name %s --kubeconfig %s", k.Name, k.Kubeconfig))
+	os.Remove(k.configFile) // nolint: errcheck
+	os.Remove(k.Kubeconfig) // nolint: errcheck
+	return err
+}
+
+// MatrixEntry names one {kubernetes, istio} release pair to run the full
+// integration suite against.
+type MatrixEntry struct {
+	KubeVersion  string
+	IstioVersion string
+}
+
+// junitTestSuite is the minimal JUnit XML shape consumed by the CI test
+// report collector.
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name    string        `xml:"name,attr"`
+	Time    float64       `xml:"time,attr"`
+	Failure *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+// RunMatrix calls runSuite once per entry with that entry's Kubernetes and
+// Istio versions, writing a per-entry junit-<entry>.xml report as it goes so
+// CI can surface matrix results without waiting for the whole job to finish.
+// RunMatrix itself creates no cluster; that is left to runSuite.
+func RunMatrix(entries []MatrixEntry, runSuite func(kubeVersion, istioVersion string) error) error {
+	var failures []string
+	for _, entry := range entries {
+		name := fmt.Sprintf("k8s-%s-istio-%s", entry.KubeVersion, entry.IstioVersion)
+		glog.Infof("matrix: running suite for %s", name)
+
+		start := time.Now()
+		runErr := runSuite(entry.KubeVersion, entry.IstioVersion)
+		elapsed := time.Since(start).Seconds()
+
+		testCase := junitTestCase{Name: name, Time: elapsed}
+		suite := junitTestSuite{Name: "integration-matrix", Tests: 1}
+		if runErr != nil {
+			glog.Errorf("matrix: %s failed: %v", name, runErr)
+			testCase.Failure = &junitFailure{Message: runErr.Error()}
+			suite.Failures = 1
+			failures = append(failures, name)
+		}
+		suite.TestCases = []junitTestCase{testCase}
+
+		out, err := xml.MarshalIndent(suite, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(fmt.Sprintf("junit-%s.xml", name), out, 0644); err != nil {
+			return err
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("matrix entries failed: %v", failures)
+	}
+	return nil
+}
@@ -21,6 +21,10 @@ import (
 	"github.com/golang/glog"
 )
 
+func init() {
+	RegisterProtocolTest(func(infra *infra) ProtocolTest { return &mongo{infra: infra} })
+}
+
 type mongo struct {
 	*infra
 	//s *mgo.Session
@@ -30,11 +34,11 @@ func (t *mongo) String() string {
 	return "mongodb"
 }
 
-func (t *mongo) setup() error {
-	if !t.Mongo {
-		return nil
-	}
+func (t *mongo) Enabled(infra *infra) bool {
+	return infra.Mongo
+}
 
+func (t *mongo) setup() error {
 	return nil
 }
 
@@ -42,10 +46,6 @@ func (t *mongo) teardown() {
 }
 
 func (t *mongo) run() error {
-	if !t.Mongo {
-		return nil
-	}
-
 	f := func() status {
 		// once to check the ratings collection
 		response := t.clientRequest(
@@ -0,0 +1,84 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"time"
+
+	proxyconfig "istio.io/api/proxy/v1/config"
+	"istio.io/pilot/platform/operator"
+)
+
+const (
+	crdEstablishedTimeout = 30 * time.Second
+	operatorReadyTimeout  = 5 * time.Minute
+)
+
+// installMode selects infra.InstallMode when it isn't set explicitly by the
+// caller constructing infra, e.g. from a test entry point that doesn't know
+// about InstallMode at all.
+var installMode = flag.String("install-mode", string(Templates),
+	`either "Templates" (apply the per-component templates) or "Operator" (apply a single IstioOperator CR)`)
+
+// resolveInstallMode defaults infra.InstallMode from the -install-mode flag
+// when the caller hasn't set it explicitly.
+func (infra *infra) resolveInstallMode() {
+	if infra.InstallMode == "" {
+		infra.InstallMode = InstallMode(*installMode)
+	}
+}
+
+// deployControlPlaneViaOperator installs the Istio operator into
+// IstioNamespace and applies a single IstioOperator CR toggling components
+// per the infra switches, in place of the per-component template deploys.
+func (infra *infra) deployControlPlaneViaOperator() error {
+	if yaml, err := fill("operator-crd.yaml.tmpl", infra); err != nil {
+		return err
+	} else if err = infra.kubeApply(yaml, infra.IstioNamespace); err != nil {
+		return err
+	}
+
+	if yaml, err := fill("operator-deployment.yaml.tmpl", infra); err != nil {
+		return err
+	} else if err = infra.kubeApply(yaml, infra.IstioNamespace); err != nil {
+		return err
+	}
+
+	a, err := infra.applier()
+	if err != nil {
+		return err
+	}
+
+	// the API server won't accept IstioOperator instances until it has
+	// finished establishing the CRD just applied above
+	if err := operator.WaitCRDEstablished(a.dynamicClient, operator.CRDName, crdEstablishedTimeout); err != nil {
+		return err
+	}
+
+	cr := operator.BuildCR(infra.IstioNamespace, infra.Name, operator.Components{
+		Mixer:   infra.Mixer,
+		Ingress: infra.Ingress,
+		Egress:  infra.Egress,
+		Auth:    infra.Auth != proxyconfig.MeshConfig_NONE,
+		Zipkin:  infra.Zipkin,
+	})
+
+	if err := applyWithRetry(func() error { return a.ApplyObject(cr, infra.IstioNamespace) }); err != nil {
+		return err
+	}
+
+	return operator.WaitReady(a.dynamicClient, infra.IstioNamespace, infra.Name, operatorReadyTimeout)
+}
@@ -0,0 +1,92 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+// protocols is the flag that setProtocolFlags reads from at runtime, e.g.
+// "-protocols=mongo,redis".
+var protocols = flag.String("protocols", "", "comma-separated list of protocol test drivers to enable (mongo, redis)")
+
+// ProtocolTest is an L7 filter integration test, such as mongo or redis. New
+// protocol drivers register themselves via RegisterProtocolTest instead of
+// being wired into the runner by hand.
+type ProtocolTest interface {
+	String() string
+	setup() error
+	teardown()
+	run() error
+
+	// Enabled reports whether this test should run for the given infra,
+	// typically backed by a per-protocol switch such as infra.Mongo.
+	Enabled(infra *infra) bool
+}
+
+// ProtocolTestFactory builds a ProtocolTest bound to a particular infra.
+type ProtocolTestFactory func(infra *infra) ProtocolTest
+
+var protocolTestFactories []ProtocolTestFactory
+
+// RegisterProtocolTest adds a protocol driver to the set run by
+// runProtocolTests. Called from the driver's init().
+func RegisterProtocolTest(f ProtocolTestFactory) {
+	protocolTestFactories = append(protocolTestFactories, f)
+}
+
+// protocolTests instantiates every registered driver against infra.
+func protocolTests(infra *infra) []ProtocolTest {
+	tests := make([]ProtocolTest, 0, len(protocolTestFactories))
+	for _, f := range protocolTestFactories {
+		tests = append(tests, f(infra))
+	}
+	return tests
+}
+
+// runProtocolTests runs setup/run/teardown for every registered driver that
+// is Enabled for infra.
+func runProtocolTests(infra *infra) error {
+	for _, t := range protocolTests(infra) {
+		if !t.Enabled(infra) {
+			continue
+		}
+		if err := t.setup(); err != nil {
+			return err
+		}
+		defer t.teardown()
+		if err := t.run(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setProtocolFlags turns a "--protocols=mongo,redis" flag value into the
+// matching per-driver switches on infra (infra.Mongo, infra.Redis). Names
+// other than "mongo" and "redis" are ignored.
+func setProtocolFlags(infra *infra, protocols string) {
+	for _, name := range strings.Split(protocols, ",") {
+		switch strings.TrimSpace(name) {
+		case "mongo":
+			infra.Mongo = true
+		case "redis":
+			infra.Redis = true
+		case "":
+			// allow a trailing comma or an empty flag value
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang/glog"
+)
+
+func init() {
+	RegisterProtocolTest(func(infra *infra) ProtocolTest { return &redis{infra: infra} })
+}
+
+type redis struct {
+	*infra
+}
+
+func (t *redis) String() string {
+	return "redis"
+}
+
+func (t *redis) Enabled(infra *infra) bool {
+	return infra.Redis
+}
+
+func (t *redis) setup() error {
+	return nil
+}
+
+func (t *redis) teardown() {
+}
+
+func (t *redis) run() error {
+	f := func() status {
+		addr := fmt.Sprintf("redis://redis.%s:6379", t.IstioNamespace)
+
+		for _, cmd := range []string{"SET foo bar", "GET foo", "INCR counter"} {
+			response := t.clientRequest("t", addr, 1, cmd)
+			if len(response.code) == 0 || response.code[0] != httpOk {
+				return errors.New(response.body)
+			}
+			glog.Infof("%s: %#v", cmd, response)
+		}
+		return nil
+	}
+
+	return parallel(map[string]func() status{
+		"set/get/incr on redis": f,
+	})
+}